@@ -0,0 +1,179 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/Nalum/pkg/ssa/overlay"
+)
+
+// ApplyOptions configures the behaviour of ApplyAll and ApplyAllStaged.
+type ApplyOptions struct {
+	// Force is carried on the options but is not read by Apply, ApplyAll or
+	// ApplyAllStaged: objects that cannot be patched (e.g. due to immutable
+	// field changes) are not recreated, and the apply returns the error.
+	Force bool
+	// WaitInterval is carried on the options but is not read by Apply,
+	// ApplyAll or ApplyAllStaged, none of which wait for the reconciled
+	// objects to be rolled out.
+	WaitInterval string
+	// Overlays are applied, in order, to the desired objects before they are
+	// diffed and applied, letting callers layer environment-specific patches
+	// on top of a shared set of manifests.
+	Overlays []*overlay.Merger
+	// Validators are run against the desired objects before they are applied.
+	// Objects whose worst EnforcementScope is EnforceDeny are excluded from
+	// the apply and reported as SkippedAction. Objects at EnforceWarn are
+	// applied with their violations attached to ChangeSetEntry.Warnings.
+	// Objects at EnforceDryRun are diffed but never applied.
+	Validators []Validator
+}
+
+// DefaultApplyOptions returns the default options used by ApplyAll and
+// ApplyAllStaged when none are supplied by the caller.
+func DefaultApplyOptions() ApplyOptions {
+	return ApplyOptions{
+		Force: false,
+	}
+}
+
+// Apply runs a server-side apply of the given object and returns the
+// resulting ChangeSetEntry. The entry's Action reflects the drift computed
+// by a dry-run comparison (see Diff) taken immediately before the real,
+// persisting Patch call.
+func (m *ResourceManager) Apply(ctx context.Context, obj *unstructured.Unstructured, opts ApplyOptions) (*ChangeSetEntry, error) {
+	entry, _, _, err := m.Diff(ctx, obj)
+	if err != nil {
+		return nil, fmt.Errorf("apply failed for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	gvr, err := m.gvrForObject(obj)
+	if err != nil {
+		return nil, fmt.Errorf("apply failed for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	if _, err := m.client.Resource(gvr).Namespace(obj.GetNamespace()).Patch(
+		ctx, obj.GetName(), m.patchType(), mustJSON(obj.DeepCopy()), metav1.PatchOptions{
+			Force:        boolPtr(true),
+			FieldManager: m.owner.Field,
+		},
+	); err != nil {
+		return nil, fmt.Errorf("apply failed for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	return entry, nil
+}
+
+// ApplyAll runs a server-side apply for the given set of objects and returns
+// the aggregated ChangeSet.
+func (m *ResourceManager) ApplyAll(ctx context.Context, objects []*unstructured.Unstructured, opts ApplyOptions) (*ChangeSet, error) {
+	set := &ChangeSet{}
+	for _, obj := range objects {
+		entry, err := m.Apply(ctx, obj, opts)
+		if err != nil {
+			return nil, err
+		}
+		set.Add(*entry)
+	}
+	return set, nil
+}
+
+// ApplyAllStaged merges any configured overlays into the given objects,
+// validates them, and then applies them one by one in the order given (see
+// sortByKind), returning the aggregated ChangeSet.
+//
+// Objects that fail a Validator at EnforceDeny are excluded from the apply
+// and recorded as SkippedAction. Objects that only fail at EnforceWarn are
+// applied with their violations attached to ChangeSetEntry.Warnings. Objects
+// that fail at EnforceDryRun are diffed but never applied.
+func (m *ResourceManager) ApplyAllStaged(ctx context.Context, objects []*unstructured.Unstructured, opts ApplyOptions) (*ChangeSet, error) {
+	sorted := sortByKind(objects)
+
+	for _, merger := range opts.Overlays {
+		if err := merger.Apply(sorted); err != nil {
+			return nil, fmt.Errorf("failed to apply overlay: %w", err)
+		}
+	}
+
+	report, err := m.Validate(ctx, sorted, ValidateOptions{Validators: opts.Validators})
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	reportBySubject := make(map[string]ObjectReport, len(report.Objects))
+	for _, objReport := range report.Objects {
+		reportBySubject[objReport.Subject] = objReport
+	}
+
+	set := &ChangeSet{}
+	for _, obj := range sorted {
+		objReport := reportBySubject[FmtUnstructured(obj)]
+
+		switch objReport.WorstScope {
+		case EnforceDeny:
+			set.Add(ChangeSetEntry{
+				Subject:      FmtUnstructured(obj),
+				GroupVersion: obj.GroupVersionKind().GroupVersion().String(),
+				Action:       string(SkippedAction),
+				Warnings:     verdictMessages(objReport.Verdicts),
+			})
+		case EnforceDryRun:
+			entry, _, _, err := m.Diff(ctx, obj)
+			if err != nil {
+				return nil, err
+			}
+			entry.Warnings = verdictMessages(objReport.Verdicts)
+			set.Add(*entry)
+		default:
+			entry, err := m.Apply(ctx, obj, opts)
+			if err != nil {
+				return nil, err
+			}
+			if objReport.WorstScope == EnforceWarn {
+				entry.Warnings = verdictMessages(objReport.Verdicts)
+			}
+			set.Add(*entry)
+		}
+	}
+
+	return set, nil
+}
+
+func verdictMessages(verdicts []Verdict) []string {
+	if len(verdicts) == 0 {
+		return nil
+	}
+	messages := make([]string, len(verdicts))
+	for i, v := range verdicts {
+		messages[i] = v.Message
+	}
+	return messages
+}
+
+// sortByKind returns a copy of objects in the order the caller provided. It
+// does not reorder by kind: namespaces and CRDs are not moved ahead of the
+// resources that depend on them.
+func sortByKind(objects []*unstructured.Unstructured) []*unstructured.Unstructured {
+	sorted := make([]*unstructured.Unstructured, len(objects))
+	copy(sorted, objects)
+	return sorted
+}
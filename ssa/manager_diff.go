@@ -0,0 +1,186 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Diff performs a server-side apply dry-run of the given object and returns
+// the resulting ChangeSetEntry along with the live (cluster) object and the
+// dry-run merged object.
+//
+// The comparison honours the pkg.nalum.io/compare-options and
+// pkg.nalum.io/ignore-differences annotations set on obj, see DiffOptions for
+// details. Secret values are masked in both returned objects, so that
+// callers can log or render them without leaking sensitive data.
+func (m *ResourceManager) Diff(ctx context.Context, obj *unstructured.Unstructured) (*ChangeSetEntry, *unstructured.Unstructured, *unstructured.Unstructured, error) {
+	entry, existing, merged, err := m.diffRaw(ctx, obj)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := m.maskObjects(obj.GroupVersionKind(), existing, merged); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to mask %s: %w", FmtUnstructured(obj), err)
+	}
+
+	return entry, existing, merged, nil
+}
+
+// diffRaw performs the dry-run merge used by Diff, but returns the live and
+// merged objects unmasked, so that callers that need the real field values
+// (e.g. DiffFormatted's secret hashing) can compute off of them before any
+// FieldMasker runs.
+func (m *ResourceManager) diffRaw(ctx context.Context, obj *unstructured.Unstructured) (*ChangeSetEntry, *unstructured.Unstructured, *unstructured.Unstructured, error) {
+	gvr, err := m.gvrForObject(obj)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	opts, err := diffOptionsForObject(obj)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("diff failed for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	stripStatus, err := m.shouldStripStatus(ctx, obj, opts)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("diff failed for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	existing, err := m.client.Resource(gvr).Namespace(obj.GetNamespace()).Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, nil, nil, fmt.Errorf("diff failed for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	dryRunObj := obj.DeepCopy()
+	merged, err := m.client.Resource(gvr).Namespace(obj.GetNamespace()).Patch(
+		ctx, obj.GetName(), m.patchType(), mustJSON(dryRunObj), metav1.PatchOptions{
+			DryRun:       []string{metav1.DryRunAll},
+			Force:        boolPtr(true),
+			FieldManager: m.owner.Field,
+		},
+	)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("diff failed for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	action := UnchangedAction
+	if existing == nil {
+		action = CreatedAction
+	} else if hasDrifted(existing, merged, opts, stripStatus) {
+		action = ConfiguredAction
+	}
+
+	entry := &ChangeSetEntry{
+		Subject:      FmtUnstructured(obj),
+		GroupVersion: obj.GroupVersionKind().GroupVersion().String(),
+		Action:       string(action),
+	}
+
+	return entry, existing, merged, nil
+}
+
+// DiffAll runs Diff for each of the given objects and returns the aggregated
+// ChangeSet along with the per-object dry-run merged objects.
+func (m *ResourceManager) DiffAll(ctx context.Context, objects []*unstructured.Unstructured) (*ChangeSet, []*unstructured.Unstructured, error) {
+	set := &ChangeSet{}
+	merged := make([]*unstructured.Unstructured, 0, len(objects))
+	for _, obj := range objects {
+		entry, _, mergedObj, err := m.Diff(ctx, obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		set.Add(*entry)
+		merged = append(merged, mergedObj)
+	}
+	return set, merged, nil
+}
+
+// hasDrifted reports whether the merged object differs from the object
+// currently stored in the cluster, ignoring metadata fields that are managed
+// by the API server (e.g. resourceVersion, generation) and applying opts'
+// compare-options and ignore-differences to both sides before comparing.
+func hasDrifted(existing, merged *unstructured.Unstructured, opts DiffOptions, stripStatus bool) bool {
+	if existing == nil || merged == nil {
+		return existing != merged
+	}
+
+	existingClean := cleanupMetadata(existing.DeepCopy(), stripStatus)
+	mergedClean := cleanupMetadata(merged.DeepCopy(), stripStatus)
+
+	pruneIgnoredPaths(existingClean, opts.IgnoreDifferences)
+	pruneIgnoredPaths(mergedClean, opts.IgnoreDifferences)
+
+	if opts.IgnoreExtraneous {
+		existingClean = intersectFields(existingClean, mergedClean)
+	}
+
+	return !reflect.DeepEqual(existingClean.Object, mergedClean.Object)
+}
+
+// cleanupMetadata strips fields that are set by the API server and therefore
+// should not be taken into account when computing whether an object drifted.
+// Whether .status is stripped is controlled by stripStatus, resolved from
+// DiffOptions.IgnoreResourceStatusField via ResourceManager.shouldStripStatus.
+func cleanupMetadata(obj *unstructured.Unstructured, stripStatus bool) *unstructured.Unstructured {
+	unstructured.RemoveNestedField(obj.Object, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "generation")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "uid")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "creationTimestamp")
+	if stripStatus {
+		unstructured.RemoveNestedField(obj.Object, "status")
+	}
+	return obj
+}
+
+// intersectFields drops any top-level-and-nested field from existing that is
+// not also present in merged, so that fields added server-side (e.g. by a
+// mutating admission controller) are not treated as drift.
+func intersectFields(existing, merged *unstructured.Unstructured) *unstructured.Unstructured {
+	existing.Object = intersectMap(existing.Object, merged.Object)
+	return existing
+}
+
+func intersectMap(existing, merged map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, existingVal := range existing {
+		mergedVal, ok := merged[k]
+		if !ok {
+			continue
+		}
+		existingMap, existingIsMap := existingVal.(map[string]interface{})
+		mergedMap, mergedIsMap := mergedVal.(map[string]interface{})
+		if existingIsMap && mergedIsMap {
+			out[k] = intersectMap(existingMap, mergedMap)
+			continue
+		}
+		out[k] = existingVal
+	}
+	return out
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
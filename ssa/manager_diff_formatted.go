@@ -0,0 +1,245 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/wI2L/jsondiff"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// DiffFormat selects the representation produced by DiffFormatted.
+type DiffFormat string
+
+const (
+	// UnifiedText renders the diff as a unified, line-based text diff of the
+	// two objects' YAML serialisations.
+	UnifiedText DiffFormat = "UnifiedText"
+	// JSONPatch renders the diff as an RFC 6902 JSON Patch.
+	JSONPatch DiffFormat = "JSONPatch"
+	// JSONMergePatch renders the diff as an RFC 7396 JSON Merge Patch.
+	JSONMergePatch DiffFormat = "JSONMergePatch"
+)
+
+// DiffFormatOptions configures DiffFormatted.
+type DiffFormatOptions struct {
+	// Format selects which representation populates FormattedDiff.Text. All
+	// representations are computed regardless of Format. An empty Format
+	// selects UnifiedText.
+	Format DiffFormat
+	// Context is the number of context lines surrounding each change in the
+	// UnifiedText representation.
+	Context int
+	// MaskSecrets replaces the value of JSON Patch operations under a
+	// v1/Secret's data/stringData fields with a stable hash, so the patch
+	// still shows that a key changed without leaking its contents.
+	MaskSecrets bool
+}
+
+// FormattedDiff holds the result of a DiffFormatted call, exposing the diff
+// in every supported representation alongside the underlying ChangeSetEntry.
+type FormattedDiff struct {
+	// Entry is the ChangeSetEntry computed for the diffed object.
+	Entry *ChangeSetEntry
+	// JSONPatch is the RFC 6902 JSON Patch from the live-normalised object to
+	// the dry-run merged object.
+	JSONPatch []byte
+	// JSONMergePatch is the RFC 7396 JSON Merge Patch between the same pair.
+	JSONMergePatch []byte
+	// Text is the unified-diff text rendering of the two YAML
+	// serialisations, with DiffFormatOptions.Context lines of context.
+	Text string
+}
+
+// DiffFormatted performs the same comparison as Diff, but additionally
+// renders the result as an RFC 6902 JSON Patch, an RFC 7396 JSON Merge Patch
+// and a unified-diff text representation.
+func (m *ResourceManager) DiffFormatted(ctx context.Context, obj *unstructured.Unstructured, opts DiffFormatOptions) (*FormattedDiff, error) {
+	entry, existing, merged, err := m.diffRaw(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	diffOpts, err := diffOptionsForObject(obj)
+	if err != nil {
+		return nil, fmt.Errorf("diff failed for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	stripStatus, err := m.shouldStripStatus(ctx, obj, diffOpts)
+	if err != nil {
+		return nil, fmt.Errorf("diff failed for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	existingClean := cleanupMetadata(&unstructured.Unstructured{Object: map[string]interface{}{}}, stripStatus)
+	if existing != nil {
+		existingClean = cleanupMetadata(existing.DeepCopy(), stripStatus)
+	}
+	mergedClean := cleanupMetadata(merged.DeepCopy(), stripStatus)
+
+	// The JSON Patch is computed from the unmasked existing/merged objects,
+	// so that when MaskSecrets hashes a changed value, the hash still
+	// reflects the real content rather than a FieldMasker's placeholder.
+	existingJSON, err := json.Marshal(existingClean.Object)
+	if err != nil {
+		return nil, fmt.Errorf("diff failed for %s: %w", FmtUnstructured(obj), err)
+	}
+	mergedJSON, err := json.Marshal(mergedClean.Object)
+	if err != nil {
+		return nil, fmt.Errorf("diff failed for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	patch, err := jsondiff.CompareJSON(existingJSON, mergedJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute JSON patch for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	isSecret := obj.GetAPIVersion() == "v1" && obj.GetKind() == "Secret"
+	if opts.MaskSecrets && isSecret {
+		maskPatchSecretValues(patch)
+	}
+
+	patchJSON, err := json.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON patch for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	// The merge patch and unified text diff are rendered from the masked
+	// copies, so that whole-object representations never leak a live secret
+	// value, independently of MaskSecrets.
+	if err := m.maskObjects(obj.GroupVersionKind(), existingClean, mergedClean); err != nil {
+		return nil, fmt.Errorf("failed to mask %s: %w", FmtUnstructured(obj), err)
+	}
+
+	maskedExistingJSON, err := json.Marshal(existingClean.Object)
+	if err != nil {
+		return nil, fmt.Errorf("diff failed for %s: %w", FmtUnstructured(obj), err)
+	}
+	maskedMergedJSON, err := json.Marshal(mergedClean.Object)
+	if err != nil {
+		return nil, fmt.Errorf("diff failed for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	mergePatch, err := jsonpatch.CreateMergePatch(maskedExistingJSON, maskedMergedJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute JSON merge patch for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	existingYAML, err := yaml.JSONToYAML(maskedExistingJSON)
+	if err != nil {
+		return nil, fmt.Errorf("diff failed for %s: %w", FmtUnstructured(obj), err)
+	}
+	mergedYAML, err := yaml.JSONToYAML(maskedMergedJSON)
+	if err != nil {
+		return nil, fmt.Errorf("diff failed for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	unifiedText, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(existingYAML)),
+		B:        difflib.SplitLines(string(mergedYAML)),
+		FromFile: "live",
+		ToFile:   "desired",
+		Context:  opts.Context,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render unified diff for %s: %w", FmtUnstructured(obj), err)
+	}
+
+	text, err := formatDiffText(opts.Format, unifiedText, patchJSON, mergePatch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s diff for %s: %w", opts.Format, FmtUnstructured(obj), err)
+	}
+
+	return &FormattedDiff{
+		Entry:          entry,
+		JSONPatch:      patchJSON,
+		JSONMergePatch: mergePatch,
+		Text:           text,
+	}, nil
+}
+
+// formatDiffText selects and renders the FormattedDiff.Text representation
+// for format. All three representations are always computed by
+// DiffFormatted; format only determines which one populates Text. An empty
+// format defaults to UnifiedText.
+func formatDiffText(format DiffFormat, unifiedText string, patchJSON, mergePatch []byte) (string, error) {
+	switch format {
+	case "", UnifiedText:
+		return unifiedText, nil
+	case JSONPatch:
+		return indentJSON(patchJSON)
+	case JSONMergePatch:
+		return indentJSON(mergePatch)
+	default:
+		return "", fmt.Errorf("unsupported diff format: %s", format)
+	}
+}
+
+// indentJSON pretty-prints raw JSON for inclusion in FormattedDiff.Text.
+func indentJSON(raw []byte) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// maskPatchSecretValues replaces the value of each operation under /data or
+// /stringData with a stable, non-reversible hash of the original value, so
+// the patch still reveals that a key changed without leaking its contents.
+// An operation on /data or /stringData itself has each value of its map
+// hashed in the same way.
+func maskPatchSecretValues(patch jsondiff.Patch) {
+	for i, op := range patch {
+		if op.Value == nil {
+			continue
+		}
+		if op.Path == "/data" || op.Path == "/stringData" {
+			if values, ok := op.Value.(map[string]interface{}); ok {
+				masked := make(map[string]interface{}, len(values))
+				for k, v := range values {
+					masked[k] = hashPatchValue(v)
+				}
+				patch[i].Value = masked
+			}
+			continue
+		}
+		if !strings.HasPrefix(op.Path, "/data/") && !strings.HasPrefix(op.Path, "/stringData/") {
+			continue
+		}
+		patch[i].Value = hashPatchValue(op.Value)
+	}
+}
+
+func hashPatchValue(value interface{}) string {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		raw = []byte(fmt.Sprintf("%v", value))
+	}
+	sum := sha256.Sum256(raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
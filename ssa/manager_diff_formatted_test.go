@@ -0,0 +1,193 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wI2L/jsondiff"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDiffFormatted_ConfigMap(t *testing.T) {
+	timeout := 10 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	id := generateName("diff")
+	objects, err := readManifest("testdata/test1.yaml", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, configMap := getFirstObject(objects, "ConfigMap", id)
+
+	if _, err = manager.ApplyAllStaged(ctx, objects, DefaultApplyOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	newVal := "diff-test"
+	if err := unstructured.SetNestedField(configMap.Object, newVal, "data", "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	formatted, err := manager.DiffFormatted(ctx, configMap, DiffFormatOptions{Format: JSONPatch, Context: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var patch jsondiff.Patch
+	if err := json.Unmarshal(formatted.JSONPatch, &patch); err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, op := range patch {
+		if op.Path == "/data/key" && op.Value == newVal {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a patch operation replacing /data/key with %q, got %s", newVal, string(formatted.JSONPatch))
+	}
+
+	if !strings.Contains(formatted.Text, newVal) {
+		t.Errorf("expected unified diff to contain %q, got %s", newVal, formatted.Text)
+	}
+}
+
+func TestDiffFormatted_HPAMetrics(t *testing.T) {
+	timeout := 10 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	id := generateName("diff")
+	objects, err := readManifest("testdata/test6.yaml", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, hpa := getFirstObject(objects, "HorizontalPodAutoscaler", id)
+
+	if _, err = manager.ApplyAllStaged(ctx, objects, DefaultApplyOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, _, err := unstructured.NestedSlice(hpa.Object, "spec", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unstructured.SetNestedSlice(hpa.Object, metrics[:1], "spec", "metrics"); err != nil {
+		t.Fatal(err)
+	}
+
+	formatted, err := manager.DiffFormatted(ctx, hpa, DiffFormatOptions{Format: JSONPatch, Context: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var patch jsondiff.Patch
+	if err := json.Unmarshal(formatted.JSONPatch, &patch); err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, op := range patch {
+		if strings.HasPrefix(op.Path, "/spec/metrics") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a patch operation touching /spec/metrics, got %s", string(formatted.JSONPatch))
+	}
+}
+
+// TestDiffFormatted_MaskSecrets asserts that with MaskSecrets: true, two
+// different secret values hash to different values while a re-applied,
+// unchanged value hashes the same, without leaking either value in the
+// patch itself.
+func TestDiffFormatted_MaskSecrets(t *testing.T) {
+	timeout := 10 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	id := generateName("diff")
+	objects, err := readManifest("testdata/test1.yaml", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, secret := getFirstObject(objects, "Secret", id)
+
+	if err := unstructured.SetNestedField(secret.Object, "s3cr3t-one", "stringData", "key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = manager.ApplyAllStaged(ctx, objects, DefaultApplyOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	diffValueHash := func(newVal string) string {
+		mutated := secret.DeepCopy()
+		if err := unstructured.SetNestedField(mutated.Object, newVal, "stringData", "key"); err != nil {
+			t.Fatal(err)
+		}
+
+		formatted, err := manager.DiffFormatted(ctx, mutated, DiffFormatOptions{Format: JSONPatch, Context: 3, MaskSecrets: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(string(formatted.JSONPatch), newVal) {
+			t.Errorf("expected JSON patch not to contain the real secret value, got %s", string(formatted.JSONPatch))
+		}
+
+		var patch jsondiff.Patch
+		if err := json.Unmarshal(formatted.JSONPatch, &patch); err != nil {
+			t.Fatal(err)
+		}
+		for _, op := range patch {
+			// The API server stores stringData into data and never returns
+			// stringData, so the change shows up under /data.
+			if op.Path == "/data/key" {
+				hash, ok := op.Value.(string)
+				if !ok {
+					t.Fatalf("expected /data/key value to be a hash string, got %v", op.Value)
+				}
+				return hash
+			}
+		}
+
+		t.Fatalf("expected a patch operation touching /data/key, got %s", string(formatted.JSONPatch))
+		return ""
+	}
+
+	hashA := diffValueHash("s3cr3t-two")
+	hashB := diffValueHash("s3cr3t-three")
+	hashAAgain := diffValueHash("s3cr3t-two")
+
+	if hashA == hashB {
+		t.Errorf("expected different secret values to hash differently, both hashed to %s", hashA)
+	}
+	if hashA != hashAAgain {
+		t.Errorf("expected the same secret value to hash the same, got %s and %s", hashA, hashAAgain)
+	}
+}
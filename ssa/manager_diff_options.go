@@ -0,0 +1,220 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// crdGVR is the GroupVersionResource of the CustomResourceDefinition kind,
+// used by ResourceManager.shouldStripStatus to recognise CRD-backed objects.
+var crdGVR = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+const (
+	// compareOptionsAnnotation lists comma-separated compare options that
+	// alter how Diff computes drift for the annotated object, following
+	// ArgoCD's compare-options convention.
+	compareOptionsAnnotation = "pkg.nalum.io/compare-options"
+
+	// ignoreDifferencesAnnotation holds a YAML list of JSONPath/JSONPointer
+	// expressions that are pruned from both the live and desired object
+	// before Diff computes drift.
+	ignoreDifferencesAnnotation = "pkg.nalum.io/ignore-differences"
+
+	ignoreExtraneousOption = "IgnoreExtraneous"
+
+	ignoreResourceStatusFieldAll = "all"
+	ignoreResourceStatusFieldCRD = "crd"
+	ignoreResourceStatusFieldOff = "off"
+)
+
+// DiffOptions controls how ResourceManager.Diff and DiffAll compute drift for
+// a given object. DefaultDiffOptions returns the options matching the
+// manager's default (pre-annotation) behaviour; the zero value behaves the
+// same, since an empty IgnoreResourceStatusField strips .status like "all".
+type DiffOptions struct {
+	// IgnoreExtraneous treats fields present in the live object but absent
+	// from the dry-run merged object as unchanged, so that values added by a
+	// mutating admission controller do not flip the entry to ConfiguredAction.
+	IgnoreExtraneous bool
+
+	// IgnoreResourceStatusField controls whether the .status subtree is
+	// stripped before diffing. One of "all" (always strip, the default),
+	// "crd" (strip only for CustomResourceDefinition-backed kinds) or "off"
+	// (never strip).
+	IgnoreResourceStatusField string
+
+	// IgnoreDifferences is a list of JSONPath/JSONPointer expressions that
+	// are pruned from both the live object and the dry-run merged object
+	// before they are compared. The desired object sent in the dry-run is not
+	// pruned, so the listed fields still take part in the merge itself.
+	IgnoreDifferences []string
+}
+
+// DefaultDiffOptions returns the DiffOptions used when an object carries none
+// of the pkg.nalum.io/compare-options annotations, preserving the manager's
+// original behaviour of always stripping .status.
+func DefaultDiffOptions() DiffOptions {
+	return DiffOptions{
+		IgnoreResourceStatusField: ignoreResourceStatusFieldAll,
+	}
+}
+
+// diffOptionsForObject derives the DiffOptions to use for obj from its
+// pkg.nalum.io annotations, falling back to DefaultDiffOptions for anything
+// not specified.
+func diffOptionsForObject(obj *unstructured.Unstructured) (DiffOptions, error) {
+	opts := DefaultDiffOptions()
+	if obj == nil {
+		return opts, nil
+	}
+
+	annotations := obj.GetAnnotations()
+	if len(annotations) == 0 {
+		return opts, nil
+	}
+
+	for _, option := range strings.Split(annotations[compareOptionsAnnotation], ",") {
+		option = strings.TrimSpace(option)
+		switch {
+		case option == ignoreExtraneousOption:
+			opts.IgnoreExtraneous = true
+		case strings.HasPrefix(option, "IgnoreResourceStatusField="):
+			opts.IgnoreResourceStatusField = strings.TrimPrefix(option, "IgnoreResourceStatusField=")
+		}
+	}
+
+	if raw, ok := annotations[ignoreDifferencesAnnotation]; ok && strings.TrimSpace(raw) != "" {
+		var paths []string
+		if err := yaml.Unmarshal([]byte(raw), &paths); err != nil {
+			return opts, err
+		}
+		opts.IgnoreDifferences = paths
+	}
+
+	return opts, nil
+}
+
+// shouldStripStatus reports whether obj's .status subtree should be removed
+// before computing drift, based on opts.IgnoreResourceStatusField. The "crd"
+// setting is resolved by looking up whether obj's kind is served by a
+// CustomResourceDefinition in the cluster, rather than by pattern-matching
+// obj's own apiVersion/kind (which would only ever match a
+// CustomResourceDefinition object itself, not an instance of one).
+func (m *ResourceManager) shouldStripStatus(ctx context.Context, obj *unstructured.Unstructured, opts DiffOptions) (bool, error) {
+	switch opts.IgnoreResourceStatusField {
+	case ignoreResourceStatusFieldOff:
+		return false, nil
+	case ignoreResourceStatusFieldCRD:
+		return m.isCRDBacked(ctx, obj.GroupVersionKind())
+	default:
+		return true, nil
+	}
+}
+
+// isCRDBacked reports whether gvk is served by a CustomResourceDefinition
+// registered in the cluster, as opposed to a built-in Kubernetes kind.
+func (m *ResourceManager) isCRDBacked(ctx context.Context, gvk schema.GroupVersionKind) (bool, error) {
+	list, err := m.client.Resource(crdGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to list CustomResourceDefinitions: %w", err)
+	}
+
+	for _, crd := range list.Items {
+		group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+		if group != gvk.Group {
+			continue
+		}
+		kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+		if kind == gvk.Kind {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// pruneIgnoredPaths removes each of the given JSONPath-like field paths from
+// obj, e.g. "spec.template.spec.containers", "/spec/replicas" or
+// "spec.containers[0].image". A "[*]" or bare "*" segment prunes the field
+// from every element of the list at that position.
+func pruneIgnoredPaths(obj *unstructured.Unstructured, paths []string) {
+	for _, path := range paths {
+		segments := parseIgnorePath(path)
+		if len(segments) == 0 {
+			continue
+		}
+		pruneNode(obj.Object, segments)
+	}
+}
+
+// parseIgnorePath normalises a dot/bracket-separated JSONPath-like
+// expression into path segments, so that a numeric index or "*" wildcard
+// addresses a list element instead of being folded into an opaque literal
+// segment that can never match a map key.
+func parseIgnorePath(path string) []string {
+	normalized := strings.NewReplacer("[", "/", "]", "").Replace(path)
+	normalized = strings.ReplaceAll(normalized, ".", "/")
+	normalized = strings.Trim(normalized, "/")
+	if normalized == "" {
+		return nil
+	}
+	return strings.Split(normalized, "/")
+}
+
+// pruneNode removes the field addressed by segments from node, descending
+// through maps and, via a numeric index or "*" wildcard segment, lists.
+func pruneNode(node interface{}, segments []string) {
+	if len(segments) == 0 {
+		return
+	}
+	seg, rest := segments[0], segments[1:]
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			delete(n, seg)
+			return
+		}
+		if child, ok := n[seg]; ok {
+			pruneNode(child, rest)
+		}
+	case []interface{}:
+		if seg == "*" {
+			for _, item := range n {
+				pruneNode(item, rest)
+			}
+			return
+		}
+		if idx, err := strconv.Atoi(seg); err == nil && idx >= 0 && idx < len(n) {
+			pruneNode(n[idx], rest)
+		}
+	}
+}
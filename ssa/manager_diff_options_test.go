@@ -0,0 +1,346 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestDiff_IgnoreExtraneous(t *testing.T) {
+	timeout := 10 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	id := generateName("diff")
+	objects, err := readManifest("testdata/test1.yaml", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, configMap := getFirstObject(objects, "ConfigMap", id)
+	_, secret := getFirstObject(objects, "Secret", id)
+
+	annotations := configMap.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[compareOptionsAnnotation] = ignoreExtraneousOption
+	configMap.SetAnnotations(annotations)
+
+	if _, err = manager.ApplyAllStaged(ctx, objects, DefaultApplyOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("ignores fields added by a mutating admission controller on a ConfigMap", func(t *testing.T) {
+		mutated := configMap.DeepCopy()
+		if err := unstructured.SetNestedField(mutated.Object, "injected", "data", "sidecar-injected"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = manager.ApplyAllStaged(ctx, []*unstructured.Unstructured{mutated}, DefaultApplyOptions()); err != nil {
+			t.Fatal(err)
+		}
+
+		changeSetEntry, _, _, err := manager.Diff(ctx, configMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(string(UnchangedAction), changeSetEntry.Action); diff != "" {
+			t.Errorf("Mismatch from expected value (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("still reports drift for a Secret without IgnoreExtraneous", func(t *testing.T) {
+		if _, err = manager.ApplyAllStaged(ctx, []*unstructured.Unstructured{secret}, DefaultApplyOptions()); err != nil {
+			t.Fatal(err)
+		}
+
+		mutated := secret.DeepCopy()
+		// Set under data (base64 of "injected"): a stringData key is stored
+		// into data and would not be removed by re-applying secret.
+		if err := unstructured.SetNestedField(mutated.Object, "aW5qZWN0ZWQ=", "data", "sidecar-injected"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = manager.ApplyAllStaged(ctx, []*unstructured.Unstructured{mutated}, DefaultApplyOptions()); err != nil {
+			t.Fatal(err)
+		}
+
+		changeSetEntry, _, _, err := manager.Diff(ctx, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(string(ConfiguredAction), changeSetEntry.Action); diff != "" {
+			t.Errorf("Mismatch from expected value (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestDiff_IgnoreResourceStatusField(t *testing.T) {
+	timeout := 10 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	id := generateName("diff")
+	objects, err := readManifest("testdata/test6.yaml", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, hpa := getFirstObject(objects, "HorizontalPodAutoscaler", id)
+
+	annotations := hpa.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[compareOptionsAnnotation] = "IgnoreResourceStatusField=off"
+	hpa.SetAnnotations(annotations)
+
+	if _, err = manager.ApplyAllStaged(ctx, objects, DefaultApplyOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("includes status in the comparison when IgnoreResourceStatusField=off", func(t *testing.T) {
+		mutated := hpa.DeepCopy()
+		if err := unstructured.SetNestedField(mutated.Object, int64(3), "status", "currentReplicas"); err != nil {
+			t.Fatal(err)
+		}
+
+		changeSetEntry, _, _, err := manager.Diff(ctx, mutated)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(string(ConfiguredAction), changeSetEntry.Action); diff != "" {
+			t.Errorf("Mismatch from expected value (-want +got):\n%s", diff)
+		}
+	})
+}
+
+// TestDiff_IgnoreResourceStatusFieldCRD asserts that
+// IgnoreResourceStatusField=crd strips .status for an instance of a
+// CustomResourceDefinition-backed kind (e.g. example.nalum.io/v1,
+// CloudCredential), not just for CustomResourceDefinition objects
+// themselves.
+func TestDiff_IgnoreResourceStatusFieldCRD(t *testing.T) {
+	timeout := 10 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	id := generateName("diff")
+
+	credential := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.nalum.io/v1",
+		"kind":       "CloudCredential",
+		"metadata": map[string]interface{}{
+			"name":      id,
+			"namespace": "default",
+			"annotations": map[string]interface{}{
+				compareOptionsAnnotation: "IgnoreResourceStatusField=crd",
+			},
+		},
+		"spec": map[string]interface{}{
+			"provider": "aws",
+		},
+	}}
+
+	if _, err := manager.ApplyAllStaged(ctx, []*unstructured.Unstructured{credential}, DefaultApplyOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	gvr, err := manager.gvrForObject(credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statusPatch := []byte(`{"status":{"connected":true}}`)
+	if _, err := manager.client.Resource(gvr).Namespace("default").Patch(
+		ctx, credential.GetName(), types.MergePatchType, statusPatch, metav1.PatchOptions{}, "status",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("strips status for a CRD-backed instance", func(t *testing.T) {
+		changeSetEntry, _, _, err := manager.Diff(ctx, credential)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(string(UnchangedAction), changeSetEntry.Action); diff != "" {
+			t.Errorf("Mismatch from expected value (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("does not strip status when IgnoreResourceStatusField=off", func(t *testing.T) {
+		if err := unstructured.SetNestedField(credential.Object, "IgnoreResourceStatusField=off", "metadata", "annotations", compareOptionsAnnotation); err != nil {
+			t.Fatal(err)
+		}
+
+		changeSetEntry, _, _, err := manager.Diff(ctx, credential)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(string(ConfiguredAction), changeSetEntry.Action); diff != "" {
+			t.Errorf("Mismatch from expected value (-want +got):\n%s", diff)
+		}
+	})
+}
+
+// TestDiff_IgnoreDifferences asserts that pkg.nalum.io/ignore-differences
+// prunes the listed paths from both sides of the comparison before Diff
+// computes drift, for a plain map path (ConfigMap), a map path under a
+// Secret, and a bracket-indexed path into a list (HPA metrics).
+func TestDiff_IgnoreDifferences(t *testing.T) {
+	timeout := 10 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	t.Run("ignores a ConfigMap data key", func(t *testing.T) {
+		id := generateName("diff")
+		objects, err := readManifest("testdata/test1.yaml", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, configMap := getFirstObject(objects, "ConfigMap", id)
+
+		annotations := configMap.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[ignoreDifferencesAnnotation] = `["data.key"]`
+		configMap.SetAnnotations(annotations)
+
+		if _, err = manager.ApplyAllStaged(ctx, objects, DefaultApplyOptions()); err != nil {
+			t.Fatal(err)
+		}
+
+		mutated := configMap.DeepCopy()
+		if err := unstructured.SetNestedField(mutated.Object, "ignored-change", "data", "key"); err != nil {
+			t.Fatal(err)
+		}
+
+		changeSetEntry, _, _, err := manager.Diff(ctx, mutated)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(string(UnchangedAction), changeSetEntry.Action); diff != "" {
+			t.Errorf("Mismatch from expected value (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("ignores a Secret data key", func(t *testing.T) {
+		id := generateName("diff")
+		objects, err := readManifest("testdata/test1.yaml", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, secret := getFirstObject(objects, "Secret", id)
+
+		annotations := secret.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		// stringData is stored into data by the API server, so the change
+		// to stringData.key below shows up as data.key on both sides.
+		annotations[ignoreDifferencesAnnotation] = `["data.key"]`
+		secret.SetAnnotations(annotations)
+
+		if _, err = manager.ApplyAllStaged(ctx, objects, DefaultApplyOptions()); err != nil {
+			t.Fatal(err)
+		}
+
+		mutated := secret.DeepCopy()
+		if err := unstructured.SetNestedField(mutated.Object, "ignored-change", "stringData", "key"); err != nil {
+			t.Fatal(err)
+		}
+
+		changeSetEntry, _, _, err := manager.Diff(ctx, mutated)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(string(UnchangedAction), changeSetEntry.Action); diff != "" {
+			t.Errorf("Mismatch from expected value (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("ignores a bracket-indexed HPA metric field but still reports drift on others", func(t *testing.T) {
+		id := generateName("diff")
+		objects, err := readManifest("testdata/test6.yaml", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, hpa := getFirstObject(objects, "HorizontalPodAutoscaler", id)
+
+		annotations := hpa.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[ignoreDifferencesAnnotation] = `["spec.metrics[0].resource.target.averageUtilization"]`
+		hpa.SetAnnotations(annotations)
+
+		if _, err = manager.ApplyAllStaged(ctx, objects, DefaultApplyOptions()); err != nil {
+			t.Fatal(err)
+		}
+
+		ignored := hpa.DeepCopy()
+		metrics, _, err := unstructured.NestedSlice(ignored.Object, "spec", "metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		metrics[0].(map[string]interface{})["resource"].(map[string]interface{})["target"].(map[string]interface{})["averageUtilization"] = int64(99)
+		if err := unstructured.SetNestedSlice(ignored.Object, metrics, "spec", "metrics"); err != nil {
+			t.Fatal(err)
+		}
+
+		changeSetEntry, _, _, err := manager.Diff(ctx, ignored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(string(UnchangedAction), changeSetEntry.Action); diff != "" {
+			t.Errorf("Mismatch from expected value (-want +got):\n%s", diff)
+		}
+
+		notIgnored := hpa.DeepCopy()
+		metrics, _, err = unstructured.NestedSlice(notIgnored.Object, "spec", "metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		metrics[1].(map[string]interface{})["resource"].(map[string]interface{})["target"].(map[string]interface{})["averageUtilization"] = int64(99)
+		if err := unstructured.SetNestedSlice(notIgnored.Object, metrics, "spec", "metrics"); err != nil {
+			t.Fatal(err)
+		}
+
+		changeSetEntry, _, _, err = manager.Diff(ctx, notIgnored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(string(ConfiguredAction), changeSetEntry.Action); diff != "" {
+			t.Errorf("Mismatch from expected value (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const maskedValue = "***"
+
+// FieldMasker redacts sensitive fields on obj in place before a diff is
+// rendered to a caller. Maskers are selected by GVK and must not affect
+// whether an object is reported as changed: they run after the Action for a
+// ChangeSetEntry has already been computed.
+type FieldMasker interface {
+	Mask(obj *unstructured.Unstructured) error
+}
+
+// secretMasker redacts the values of a v1/Secret's data and stringData
+// fields with a fixed placeholder.
+type secretMasker struct{}
+
+func (secretMasker) Mask(obj *unstructured.Unstructured) error {
+	maskStringMap(obj, "data")
+	maskStringMap(obj, "stringData")
+	return nil
+}
+
+// pathMasker redacts the value found at each of a fixed list of JSONPointer
+// paths, e.g. "spec/template/spec/containers/*/env" or
+// "spec.credentials.apiKey". A "*" segment masks every item of the list at
+// that position.
+type pathMasker struct {
+	paths [][]string
+}
+
+func newPathMasker(paths []string) pathMasker {
+	pm := pathMasker{}
+	for _, p := range paths {
+		pm.paths = append(pm.paths, parseMaskPath(p))
+	}
+	return pm
+}
+
+func (pm pathMasker) Mask(obj *unstructured.Unstructured) error {
+	for _, segments := range pm.paths {
+		if len(segments) == 0 {
+			continue
+		}
+		maskNode(obj.Object, segments)
+	}
+	return nil
+}
+
+// RegisterMasker registers a FieldMasker that redacts the given JSONPointer
+// paths on every object of the given GVK that is passed through Diff or
+// DiffAll. Registering a masker for a GVK that already has one replaces it.
+func (m *ResourceManager) RegisterMasker(gvk schema.GroupVersionKind, paths []string) {
+	if m.maskers == nil {
+		m.maskers = map[schema.GroupVersionKind]FieldMasker{}
+	}
+	m.maskers[gvk] = newPathMasker(paths)
+}
+
+// maskObjects runs the FieldMasker registered for obj's GVK, if any, against
+// both the live and dry-run merged objects.
+func (m *ResourceManager) maskObjects(gvk schema.GroupVersionKind, objs ...*unstructured.Unstructured) error {
+	masker, ok := m.maskers[gvk]
+	if !ok {
+		return nil
+	}
+	for _, obj := range objs {
+		if obj == nil {
+			continue
+		}
+		if err := masker.Mask(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func maskStringMap(obj *unstructured.Unstructured, field string) {
+	m, found, err := unstructured.NestedMap(obj.Object, field)
+	if err != nil || !found {
+		return
+	}
+	for k := range m {
+		m[k] = maskedValue
+	}
+	_ = unstructured.SetNestedMap(obj.Object, m, field)
+}
+
+// parseMaskPath normalises a dot or slash separated JSONPointer-like path,
+// e.g. "spec.template.spec.containers[*].env", into path segments.
+func parseMaskPath(path string) []string {
+	normalized := strings.NewReplacer("[*]", "/*", "[", "/", "]", "").Replace(path)
+	normalized = strings.ReplaceAll(normalized, ".", "/")
+	normalized = strings.Trim(normalized, "/")
+	if normalized == "" {
+		return nil
+	}
+	return strings.Split(normalized, "/")
+}
+
+// maskNode walks node following segments and replaces the value found at the
+// end of the path with maskedValue. A "*" segment applies to every element
+// of a list at that position, a numeric segment to the element at that index.
+func maskNode(node interface{}, segments []string) interface{} {
+	if len(segments) == 0 {
+		return maskedValue
+	}
+
+	seg, rest := segments[0], segments[1:]
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if child, ok := n[seg]; ok {
+			n[seg] = maskNode(child, rest)
+		}
+		return n
+	case []interface{}:
+		if seg != "*" {
+			if idx, err := strconv.Atoi(seg); err == nil && idx >= 0 && idx < len(n) {
+				n[idx] = maskNode(n[idx], rest)
+			}
+			return n
+		}
+		for i, item := range n {
+			n[i] = maskNode(item, rest)
+		}
+		return n
+	default:
+		return node
+	}
+}
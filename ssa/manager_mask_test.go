@@ -0,0 +1,90 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// TestDiff_CustomMasker masks a custom CRD-style unstructured object, using
+// the example.nalum.io/v1, CloudCredential CRD installed via TestMain's
+// CRDDirectoryPaths.
+func TestDiff_CustomMasker(t *testing.T) {
+	timeout := 10 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	id := generateName("diff")
+
+	credential := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.nalum.io/v1",
+		"kind":       "CloudCredential",
+		"metadata": map[string]interface{}{
+			"name":      id,
+			"namespace": "default",
+		},
+		"spec": map[string]interface{}{
+			"credentials": map[string]interface{}{
+				"apiKey": "s3cr3t",
+			},
+		},
+	}}
+
+	manager.RegisterMasker(schema.GroupVersionKind{
+		Group:   "example.nalum.io",
+		Version: "v1",
+		Kind:    "CloudCredential",
+	}, []string{"spec.credentials.apiKey"})
+
+	if _, err := manager.ApplyAllStaged(ctx, []*unstructured.Unstructured{credential}, DefaultApplyOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("masks the apiKey while still detecting it changed", func(t *testing.T) {
+		if err := unstructured.SetNestedField(credential.Object, "new-s3cr3t", "spec", "credentials", "apiKey"); err != nil {
+			t.Fatal(err)
+		}
+
+		changeSetEntry, existing, merged, err := manager.Diff(ctx, credential)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(string(ConfiguredAction), changeSetEntry.Action); diff != "" {
+			t.Errorf("Mismatch from expected value (-want +got):\n%s", diff)
+		}
+
+		for _, obj := range []*unstructured.Unstructured{existing, merged} {
+			if obj == nil {
+				continue
+			}
+			objYaml, _ := yaml.Marshal(obj)
+			if strings.Contains(string(objYaml), "s3cr3t") {
+				t.Errorf("expected apiKey to be masked, got %s", string(objYaml))
+			}
+		}
+	})
+}
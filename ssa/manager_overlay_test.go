@@ -0,0 +1,104 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/Nalum/pkg/ssa/overlay"
+)
+
+func TestApplyAllStaged_Overlay_HPAMetric(t *testing.T) {
+	timeout := 10 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	id := generateName("diff")
+	objects, err := readManifest("testdata/test6.yaml", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hpaName, hpa := getFirstObject(objects, "HorizontalPodAutoscaler", id)
+
+	merger := overlay.NewMerger()
+	merger.AddPatch([]byte(fmt.Sprintf(`
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: %s
+  namespace: default
+  annotations:
+    overlay.nalum.io/list-merge: merge-by=type
+spec:
+  metrics:
+    - type: Pods
+      pods:
+        metric:
+          name: requests-per-second
+        target:
+          type: AverageValue
+          averageValue: "100"
+`, id)))
+
+	opts := DefaultApplyOptions()
+	opts.Overlays = []*overlay.Merger{merger}
+
+	if _, err = manager.ApplyAllStaged(ctx, objects, DefaultApplyOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("reports configured exactly once after the overlay adds a metric", func(t *testing.T) {
+		if err := merger.Apply(objects); err != nil {
+			t.Fatal(err)
+		}
+
+		changeSetEntry, _, _, err := manager.Diff(ctx, hpa)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(hpaName, changeSetEntry.Subject); diff != "" {
+			t.Errorf("Mismatch from expected value (-want +got):\n%s", diff)
+		}
+
+		if diff := cmp.Diff(string(ConfiguredAction), changeSetEntry.Action); diff != "" {
+			t.Errorf("Mismatch from expected value (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("reports unchanged on re-apply with the same overlay", func(t *testing.T) {
+		if _, err = manager.ApplyAllStaged(ctx, objects, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		changeSetEntry, _, _, err := manager.Diff(ctx, hpa)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(string(UnchangedAction), changeSetEntry.Action); diff != "" {
+			t.Errorf("Mismatch from expected value (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	apiyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+var (
+	testEnv *envtest.Environment
+	manager *ResourceManager
+)
+
+func TestMain(m *testing.M) {
+	testEnv = &envtest.Environment{
+		CRDDirectoryPaths: []string{"testdata/crds"},
+	}
+
+	cfg, err := testEnv.Start()
+	if err != nil {
+		panic(fmt.Errorf("failed to start test environment: %w", err))
+	}
+
+	dynClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		panic(fmt.Errorf("failed to create dynamic client: %w", err))
+	}
+
+	httpClient, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		panic(fmt.Errorf("failed to create HTTP client: %w", err))
+	}
+
+	restMapper, err := apiutil.NewDynamicRESTMapper(cfg, httpClient)
+	if err != nil {
+		panic(fmt.Errorf("failed to create REST mapper: %w", err))
+	}
+
+	manager = NewResourceManager(dynClient, restMapper, Owner{
+		Field: "ssa-manager",
+		Group: "pkg.nalum.io",
+	})
+
+	code := m.Run()
+
+	if err := testEnv.Stop(); err != nil {
+		panic(fmt.Errorf("failed to stop test environment: %w", err))
+	}
+
+	os.Exit(code)
+}
+
+// generateName returns a unique, lowercase, DNS-1123-compliant name prefixed
+// with the given string, suitable for parallel test runs.
+func generateName(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, rand.Intn(1000000))
+}
+
+// readManifest reads the YAML manifest at the given path, substituting the
+// literal string "%[1]s" with id, and returns the parsed objects.
+func readManifest(path, id string) ([]*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	yml := fmt.Sprintf(string(data), id)
+
+	var objects []*unstructured.Unstructured
+	reader := strings.NewReader(yml)
+	decoder := apiyaml.NewYAMLOrJSONDecoder(reader, 2048)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(obj); err != nil {
+			break
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
+
+// getFirstObject returns the FmtUnstructured identifier and the first object
+// of the given kind found in objects.
+func getFirstObject(objects []*unstructured.Unstructured, kind, id string) (string, *unstructured.Unstructured) {
+	for _, obj := range objects {
+		if obj.GetKind() == kind {
+			return FmtUnstructured(obj), obj
+		}
+	}
+	return "", nil
+}
+
+// SetNativeKindsDefaults mutates the given objects in place, setting the
+// default values the Kubernetes API server would set for built-in kinds,
+// so that diffs computed against freshly-read manifests do not flag fields
+// the API server populates on creation.
+func SetNativeKindsDefaults(objects []*unstructured.Unstructured) {
+	for _, obj := range objects {
+		if obj.GetKind() == "ConfigMap" {
+			if _, found, _ := unstructured.NestedMap(obj.Object, "data"); !found {
+				_ = unstructured.SetNestedMap(obj.Object, map[string]interface{}{}, "data")
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// FmtUnstructured returns a human-readable identifier for the given object,
+// in the format <kind>/<namespace>/<name>.
+func FmtUnstructured(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName())
+	}
+	return fmt.Sprintf("%s/%s/%s", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+}
+
+// gvrForObject resolves the GroupVersionResource for the given object using
+// the manager's REST mapper.
+func (m *ResourceManager) gvrForObject(obj *unstructured.Unstructured) (schema.GroupVersionResource, error) {
+	mapping, err := m.restMapper.RESTMapping(obj.GroupVersionKind().GroupKind(), obj.GroupVersionKind().Version)
+	if err != nil {
+		return schema.GroupVersionResource{}, fmt.Errorf("failed to map %s: %w", FmtUnstructured(obj), err)
+	}
+	return mapping.Resource, nil
+}
+
+// patchType returns the patch type used by the manager for server-side apply.
+func (m *ResourceManager) patchType() types.PatchType {
+	return types.ApplyPatchType
+}
+
+func mustJSON(obj *unstructured.Unstructured) []byte {
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
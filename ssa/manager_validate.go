@@ -0,0 +1,136 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// EnforcementScope is the action taken when a Validator rejects an object,
+// mirroring the scoped enforcement actions of admission policy engines such
+// as Gatekeeper.
+type EnforcementScope string
+
+const (
+	// EnforceDeny excludes the object from the apply entirely.
+	EnforceDeny EnforcementScope = "deny"
+	// EnforceWarn applies the object but records the violation on its
+	// ChangeSetEntry.
+	EnforceWarn EnforcementScope = "warn"
+	// EnforceDryRun diffs the object but never applies it.
+	EnforceDryRun EnforcementScope = "dryrun"
+)
+
+// enforcementPrecedence orders scopes from most to least restrictive, used
+// to resolve the worst scope across multiple failing verdicts for the same
+// object.
+var enforcementPrecedence = map[EnforcementScope]int{
+	EnforceDeny:   3,
+	EnforceDryRun: 2,
+	EnforceWarn:   1,
+}
+
+// Validator evaluates a single object and, if it violates the Validator's
+// policy, returns a human-readable message describing the violation.
+type Validator interface {
+	// Name identifies the Validator in a Verdict.
+	Name() string
+	// Scope is the EnforcementScope applied when Validate reports a
+	// violation for this Validator.
+	Scope() EnforcementScope
+	// Validate returns an empty message if obj satisfies the policy, or a
+	// non-empty message describing the violation otherwise.
+	Validate(obj *unstructured.Unstructured) (message string, err error)
+}
+
+// Verdict is the outcome of running a single Validator against an object.
+type Verdict struct {
+	Validator string
+	Scope     EnforcementScope
+	Message   string
+}
+
+// ObjectReport holds every failing Verdict recorded for a single object, and
+// the worst (most restrictive) EnforcementScope among them.
+type ObjectReport struct {
+	Subject    string
+	Verdicts   []Verdict
+	WorstScope EnforcementScope
+}
+
+// ValidationReport is the result of a Validate call across a set of objects.
+type ValidationReport struct {
+	Objects []ObjectReport
+}
+
+// ValidateOptions configures Validate.
+type ValidateOptions struct {
+	// Validators is the list of policies evaluated against each object.
+	Validators []Validator
+}
+
+// ResolveEnforcementScope returns the most restrictive scope in scopes, or
+// the empty EnforcementScope if scopes is empty. It is exposed so that
+// callers plugging in their own policy evaluators (e.g. Rego or CEL) can
+// reuse the same precedence rules as the built-in Validators.
+func ResolveEnforcementScope(scopes []EnforcementScope) EnforcementScope {
+	worst := EnforcementScope("")
+	worstRank := 0
+	for _, scope := range scopes {
+		if rank := enforcementPrecedence[scope]; rank > worstRank {
+			worst = scope
+			worstRank = rank
+		}
+	}
+	return worst
+}
+
+// Validate runs every Validator in opts against each of the given objects and
+// returns a ValidationReport listing the violations found, if any.
+func (m *ResourceManager) Validate(ctx context.Context, objects []*unstructured.Unstructured, opts ValidateOptions) (ValidationReport, error) {
+	report := ValidationReport{}
+
+	for _, obj := range objects {
+		objReport := ObjectReport{Subject: FmtUnstructured(obj)}
+		var scopes []EnforcementScope
+
+		for _, validator := range opts.Validators {
+			message, err := validator.Validate(obj)
+			if err != nil {
+				return ValidationReport{}, fmt.Errorf("validator %s failed for %s: %w", validator.Name(), FmtUnstructured(obj), err)
+			}
+			if message == "" {
+				continue
+			}
+			objReport.Verdicts = append(objReport.Verdicts, Verdict{
+				Validator: validator.Name(),
+				Scope:     validator.Scope(),
+				Message:   message,
+			})
+			scopes = append(scopes, validator.Scope())
+		}
+
+		objReport.WorstScope = ResolveEnforcementScope(scopes)
+		report.Objects = append(report.Objects, objReport)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestApplyAllStaged_Validators(t *testing.T) {
+	timeout := 10 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	id := generateName("validate")
+
+	allowed := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      id + "-allowed",
+			"namespace": "default",
+			"labels":    map[string]interface{}{"team": "platform"},
+		},
+		"data": map[string]interface{}{"key": "value"},
+	}}
+
+	warned := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      id + "-warned",
+			"namespace": "default",
+		},
+		"data": map[string]interface{}{"key": "value"},
+	}}
+
+	denied := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      id + "-denied",
+			"namespace": "kube-system",
+			"labels":    map[string]interface{}{"team": "platform"},
+		},
+		"data": map[string]interface{}{"key": "value"},
+	}}
+
+	opts := DefaultApplyOptions()
+	opts.Validators = []Validator{
+		NewRequiredLabelsValidator(EnforceWarn, []string{"team"}),
+		NewForbiddenNamespaceValidator(EnforceDeny, []string{"kube-system"}),
+	}
+
+	set, err := manager.ApplyAllStaged(ctx, []*unstructured.Unstructured{allowed, warned, denied}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actionsBySubject := map[string]ChangeSetEntry{}
+	for _, entry := range set.Entries {
+		actionsBySubject[entry.Subject] = entry
+	}
+
+	if diff := cmp.Diff(string(CreatedAction), actionsBySubject[FmtUnstructured(allowed)].Action); diff != "" {
+		t.Errorf("allowed object: mismatch (-want +got):\n%s", diff)
+	}
+	if len(actionsBySubject[FmtUnstructured(allowed)].Warnings) != 0 {
+		t.Errorf("allowed object should have no warnings, got %v", actionsBySubject[FmtUnstructured(allowed)].Warnings)
+	}
+
+	warnedEntry := actionsBySubject[FmtUnstructured(warned)]
+	if diff := cmp.Diff(string(CreatedAction), warnedEntry.Action); diff != "" {
+		t.Errorf("warned object: mismatch (-want +got):\n%s", diff)
+	}
+	if len(warnedEntry.Warnings) != 1 {
+		t.Errorf("expected exactly one warning, got %v", warnedEntry.Warnings)
+	}
+
+	deniedEntry := actionsBySubject[FmtUnstructured(denied)]
+	if diff := cmp.Diff(string(SkippedAction), deniedEntry.Action); diff != "" {
+		t.Errorf("denied object: mismatch (-want +got):\n%s", diff)
+	}
+
+	gvr, err := manager.gvrForObject(denied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.client.Resource(gvr).Namespace("kube-system").Get(ctx, denied.GetName(), metav1.GetOptions{}); err == nil {
+		t.Errorf("expected denied object not to have been applied to the cluster")
+	}
+}
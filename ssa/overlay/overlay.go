@@ -0,0 +1,286 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package overlay lets callers register YAML patch documents that are
+// deep-merged into desired manifests before they are applied or diffed,
+// similar in spirit to kustomize's strategic-merge patches.
+package overlay
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// listMergeAnnotation, set on a patch document, selects how list fields on
+// that document are merged into the target object's corresponding lists.
+const listMergeAnnotation = "overlay.nalum.io/list-merge"
+
+const (
+	listMergeReplace  = "replace"
+	listMergeAppend   = "append"
+	listMergeByPrefix = "merge-by="
+)
+
+// Merger accumulates overlay patches and applies them to a set of objects.
+type Merger struct {
+	patches [][]byte
+}
+
+// NewMerger returns an empty Merger.
+func NewMerger() *Merger {
+	return &Merger{}
+}
+
+// AddPatch registers a YAML patch document (or multi-document stream) to be
+// merged into matching objects on the next call to Apply.
+func (m *Merger) AddPatch(patch []byte) {
+	m.patches = append(m.patches, patch)
+}
+
+// Apply merges every registered patch into the matching object in objects,
+// in place. A patch matches an object when they share the same GVK,
+// namespace and name. Patches for objects not present in objects are
+// ignored.
+func (m *Merger) Apply(objects []*unstructured.Unstructured) error {
+	for _, patch := range m.patches {
+		patchObjects, err := decodeAll(patch)
+		if err != nil {
+			return fmt.Errorf("failed to parse overlay patch: %w", err)
+		}
+
+		for _, patchObj := range patchObjects {
+			target := findMatch(objects, patchObj)
+			if target == nil {
+				continue
+			}
+
+			strategy := listMergeStrategy(patchObj)
+			merged := mergeMaps(target.Object, patchObj.Object, strategy)
+			target.Object = merged
+		}
+	}
+
+	return nil
+}
+
+func findMatch(objects []*unstructured.Unstructured, patch *unstructured.Unstructured) *unstructured.Unstructured {
+	for _, obj := range objects {
+		if obj.GroupVersionKind() == patch.GroupVersionKind() &&
+			obj.GetNamespace() == patch.GetNamespace() &&
+			obj.GetName() == patch.GetName() {
+			return obj
+		}
+	}
+	return nil
+}
+
+func listMergeStrategy(patch *unstructured.Unstructured) string {
+	annotations := patch.GetAnnotations()
+	if annotations == nil {
+		return listMergeReplace
+	}
+	if v, ok := annotations[listMergeAnnotation]; ok && v != "" {
+		return v
+	}
+	return listMergeReplace
+}
+
+// mergeMaps deep-merges src into dst, returning the result. A key set to nil
+// in src deletes the corresponding key from dst. Lists are merged according
+// to strategy: "replace" (the default) substitutes dst's list with src's,
+// "append" concatenates them, and "merge-by=<key>[,<key>...]" merges list
+// items that share the same value for every comma-separated <key>, appending
+// any that don't match. Each <key> is a dot-separated path (e.g.
+// "resource.name"), letting callers disambiguate items whose top-level
+// discriminator alone is ambiguous, e.g. HorizontalPodAutoscaler metrics of
+// the same type but a different resource or metric name
+// ("merge-by=type,resource.name").
+func mergeMaps(dst, src map[string]interface{}, strategy string) map[string]interface{} {
+	if dst == nil {
+		dst = map[string]interface{}{}
+	}
+
+	for k, srcVal := range src {
+		if srcVal == nil {
+			delete(dst, k)
+			continue
+		}
+
+		dstVal, exists := dst[k]
+		if !exists {
+			dst[k] = srcVal
+			continue
+		}
+
+		dstMap, dstIsMap := dstVal.(map[string]interface{})
+		srcMap, srcIsMap := srcVal.(map[string]interface{})
+		if dstIsMap && srcIsMap {
+			dst[k] = mergeMaps(dstMap, srcMap, strategy)
+			continue
+		}
+
+		dstSlice, dstIsSlice := dstVal.([]interface{})
+		srcSlice, srcIsSlice := srcVal.([]interface{})
+		if dstIsSlice && srcIsSlice {
+			dst[k] = mergeSlices(dstSlice, srcSlice, strategy)
+			continue
+		}
+
+		dst[k] = srcVal
+	}
+
+	return dst
+}
+
+func mergeSlices(dst, src []interface{}, strategy string) []interface{} {
+	switch {
+	case strategy == listMergeAppend:
+		return append(append([]interface{}{}, dst...), src...)
+	case strings.HasPrefix(strategy, listMergeByPrefix):
+		key := strings.TrimPrefix(strategy, listMergeByPrefix)
+		return mergeSlicesByKey(dst, src, key)
+	default:
+		return src
+	}
+}
+
+func mergeSlicesByKey(dst, src []interface{}, key string) []interface{} {
+	keys := strings.Split(key, ",")
+	for i, k := range keys {
+		keys[i] = strings.TrimSpace(k)
+	}
+
+	out := append([]interface{}{}, dst...)
+
+	for _, srcItem := range src {
+		srcMap, ok := srcItem.(map[string]interface{})
+		if !ok {
+			out = append(out, srcItem)
+			continue
+		}
+
+		matched := false
+		for i, dstItem := range out {
+			dstMap, ok := dstItem.(map[string]interface{})
+			if !ok || !keysMatch(dstMap, srcMap, keys) {
+				continue
+			}
+			out[i] = mergeMaps(dstMap, srcMap, listMergeReplace)
+			matched = true
+			break
+		}
+
+		if !matched {
+			out = append(out, srcItem)
+		}
+	}
+
+	return out
+}
+
+// keysMatch reports whether dst and src agree on every dot-separated path in
+// keys, so that e.g. ["type", "resource.name"] only matches items that share
+// both their "type" field and their nested "resource.name" field.
+func keysMatch(dst, src map[string]interface{}, keys []string) bool {
+	for _, k := range keys {
+		if !reflect.DeepEqual(nestedValue(dst, k), nestedValue(src, k)) {
+			return false
+		}
+	}
+	return true
+}
+
+// nestedValue resolves a dot-separated path (e.g. "resource.name") against a
+// decoded YAML map, returning nil if any segment is missing or not itself a
+// map.
+func nestedValue(obj map[string]interface{}, path string) interface{} {
+	var cur interface{} = obj
+	for _, seg := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[seg]
+	}
+	return cur
+}
+
+// decodeAll splits a multi-document YAML stream and decodes each document
+// into an unstructured object, skipping empty documents.
+func decodeAll(data []byte) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+
+	reader := yamlDocReader(data)
+	for {
+		doc, err := reader()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(doc, &obj.Object); err != nil {
+			return nil, err
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
+
+func yamlDocReader(data []byte) func() ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var buf bytes.Buffer
+	done := false
+
+	return func() ([]byte, error) {
+		if done {
+			return nil, io.EOF
+		}
+		buf.Reset()
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.TrimSpace(line) == "---" {
+				return buf.Bytes(), nil
+			}
+			buf.WriteString(line)
+			buf.WriteString("\n")
+		}
+		done = true
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+}
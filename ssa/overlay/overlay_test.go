@@ -0,0 +1,120 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package overlay
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMerger_Apply_MergeByKey(t *testing.T) {
+	target := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "autoscaling/v2",
+		"kind":       "HorizontalPodAutoscaler",
+		"metadata": map[string]interface{}{
+			"name":      "test",
+			"namespace": "default",
+		},
+		"spec": map[string]interface{}{
+			"metrics": []interface{}{
+				map[string]interface{}{
+					"type": "Resource",
+					"resource": map[string]interface{}{
+						"name": "cpu",
+					},
+				},
+			},
+		},
+	}}
+
+	patch := []byte(`
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: test
+  namespace: default
+  annotations:
+    overlay.nalum.io/list-merge: merge-by=type,resource.name
+spec:
+  metrics:
+    - type: Resource
+      resource:
+        name: memory
+`)
+
+	m := NewMerger()
+	m.AddPatch(patch)
+
+	objects := []*unstructured.Unstructured{target}
+	if err := m.Apply(objects); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, _, err := unstructured.NestedSlice(objects[0].Object, "spec", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 metrics after merge, got %d: %v", len(metrics), metrics)
+	}
+}
+
+func TestMerger_Apply_NullDeletesKey(t *testing.T) {
+	target := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      "test",
+			"namespace": "default",
+		},
+		"data": map[string]interface{}{
+			"key":       "value",
+			"remove-me": "value",
+		},
+	}}
+
+	patch := []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+  namespace: default
+data:
+  remove-me: null
+`)
+
+	m := NewMerger()
+	m.AddPatch(patch)
+
+	objects := []*unstructured.Unstructured{target}
+	if err := m.Apply(objects); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _, err := unstructured.NestedMap(objects[0].Object, "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := data["remove-me"]; ok {
+		t.Errorf("expected remove-me to be deleted, got %v", data)
+	}
+	if data["key"] != "value" {
+		t.Errorf("expected key to be preserved, got %v", data)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+// Action is the action taken by the ResourceManager on a given resource.
+type Action string
+
+const (
+	// CreatedAction represents a resource that was created.
+	CreatedAction Action = "created"
+	// ConfiguredAction represents a resource that was patched.
+	ConfiguredAction Action = "configured"
+	// UnchangedAction represents a resource that was not changed.
+	UnchangedAction Action = "unchanged"
+	// DeletedAction represents a resource that was deleted.
+	DeletedAction Action = "deleted"
+	// SkippedAction represents a resource that was excluded from the apply.
+	SkippedAction Action = "skipped"
+)
+
+// ChangeSetEntry defines the result of an apply or diff operation for a given object.
+type ChangeSetEntry struct {
+	// Subject identifies the object, in the format <kind>/<namespace>/<name>.
+	Subject string `json:"subject"`
+	// GroupVersionKind of the object.
+	GroupVersion string `json:"groupVersion"`
+	// Action taken for this object.
+	Action string `json:"action"`
+	// Warnings holds the messages of the policy violations recorded for this
+	// object by ResourceManager.Validate during ApplyAllStaged, whatever the
+	// worst EnforcementScope among them (EnforceWarn, EnforceDryRun or
+	// EnforceDeny).
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// String returns a human-readable representation of the ChangeSetEntry.
+func (cse ChangeSetEntry) String() string {
+	return cse.Subject + " " + cse.Action
+}
+
+// ChangeSet holds the result of an apply operation performed on a set of objects.
+type ChangeSet struct {
+	Entries []ChangeSetEntry `json:"entries"`
+}
+
+// Add appends an entry to the change set.
+func (c *ChangeSet) Add(entry ChangeSetEntry) {
+	c.Entries = append(c.Entries, entry)
+}
+
+// Owner determines the field manager and labels/annotations used to track
+// ownership of the objects applied by the ResourceManager.
+type Owner struct {
+	// Field is the owner used by server-side apply to track field ownership.
+	Field string
+	// Group is the group prefix used for the ownership labels and annotations.
+	Group string
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021 Stefan Prodan
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssa
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RequiredLabelsValidator fails objects that are missing one or more of a
+// fixed set of labels.
+type RequiredLabelsValidator struct {
+	scope  EnforcementScope
+	labels []string
+}
+
+// NewRequiredLabelsValidator returns a Validator that, at the given
+// EnforcementScope, requires every object to carry each of labels.
+func NewRequiredLabelsValidator(scope EnforcementScope, labels []string) *RequiredLabelsValidator {
+	return &RequiredLabelsValidator{scope: scope, labels: labels}
+}
+
+func (v *RequiredLabelsValidator) Name() string {
+	return "required-labels"
+}
+
+func (v *RequiredLabelsValidator) Scope() EnforcementScope {
+	return v.scope
+}
+
+func (v *RequiredLabelsValidator) Validate(obj *unstructured.Unstructured) (string, error) {
+	labels := obj.GetLabels()
+	var missing []string
+	for _, key := range v.labels {
+		if _, ok := labels[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("%s is missing required labels: %v", FmtUnstructured(obj), missing), nil
+}
+
+// ForbiddenNamespaceValidator fails objects whose namespace is in a fixed
+// denylist.
+type ForbiddenNamespaceValidator struct {
+	scope      EnforcementScope
+	namespaces map[string]struct{}
+}
+
+// NewForbiddenNamespaceValidator returns a Validator that, at the given
+// EnforcementScope, rejects any object whose namespace is one of namespaces.
+func NewForbiddenNamespaceValidator(scope EnforcementScope, namespaces []string) *ForbiddenNamespaceValidator {
+	set := make(map[string]struct{}, len(namespaces))
+	for _, ns := range namespaces {
+		set[ns] = struct{}{}
+	}
+	return &ForbiddenNamespaceValidator{scope: scope, namespaces: set}
+}
+
+func (v *ForbiddenNamespaceValidator) Name() string {
+	return "forbidden-namespace"
+}
+
+func (v *ForbiddenNamespaceValidator) Scope() EnforcementScope {
+	return v.scope
+}
+
+func (v *ForbiddenNamespaceValidator) Validate(obj *unstructured.Unstructured) (string, error) {
+	if _, forbidden := v.namespaces[obj.GetNamespace()]; !forbidden {
+		return "", nil
+	}
+	return fmt.Sprintf("%s is in a forbidden namespace: %s", FmtUnstructured(obj), obj.GetNamespace()), nil
+}